@@ -0,0 +1,185 @@
+// Package preproc implements image preprocessing steps applied to pages
+// before downstream consumers (OCR, archiving) see them.
+package preproc
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// integralImages holds the summed-area tables used to compute an O(1)
+// local mean and variance for Sauvola binarization.
+type integralImages struct {
+	s, s2 [][]uint64
+	w, h  int
+}
+
+// buildIntegralImages converts img to 8-bit gray and builds the integral
+// image S and the squared integral image S2, both sized (h+1)x(w+1) with a
+// leading zero row/column so range sums need no bounds special-casing.
+func buildIntegralImages(img image.Image) (*integralImages, *image.Gray) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gray.Set(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	s := make([][]uint64, h+1)
+	s2 := make([][]uint64, h+1)
+	for y := range s {
+		s[y] = make([]uint64, w+1)
+		s2[y] = make([]uint64, w+1)
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := uint64(gray.GrayAt(x, y).Y)
+			s[y+1][x+1] = s[y][x+1] + s[y+1][x] - s[y][x] + p
+			s2[y+1][x+1] = s2[y][x+1] + s2[y+1][x] - s2[y][x] + p*p
+		}
+	}
+
+	return &integralImages{s: s, s2: s2, w: w, h: h}, gray
+}
+
+// rangeSum returns the sum of an integral table over [y0,y1) x [x0,x1),
+// all already clipped to the image bounds.
+func rangeSum(t [][]uint64, x0, y0, x1, y1 int) uint64 {
+	return t[y1][x1] - t[y0][x1] - t[y1][x0] + t[y0][x0]
+}
+
+// Binarize converts img to a black/white image.Gray using Sauvola adaptive
+// thresholding: for each pixel, the local mean and standard deviation are
+// computed over a window x window neighborhood (via integral images, so the
+// per-pixel cost is O(1)) and compared against T = mean * (1 + k*(stddev/128 - 1)).
+// The neighborhood is centered on the pixel, so an even window is widened to
+// the next odd size (window+1), and it is clipped at the image edges.
+func Binarize(img image.Image, window int, k float64) *image.Gray {
+	if window < 1 {
+		window = 1
+	}
+	radius := window / 2
+
+	ii, gray := buildIntegralImages(img)
+	out := image.NewGray(image.Rect(0, 0, ii.w, ii.h))
+
+	for y := 0; y < ii.h; y++ {
+		y0 := clamp(y-radius, 0, ii.h)
+		y1 := clamp(y+radius+1, 0, ii.h)
+		for x := 0; x < ii.w; x++ {
+			x0 := clamp(x-radius, 0, ii.w)
+			x1 := clamp(x+radius+1, 0, ii.w)
+
+			area := uint64((x1 - x0) * (y1 - y0))
+			sum := rangeSum(ii.s, x0, y0, x1, y1)
+			sum2 := rangeSum(ii.s2, x0, y0, x1, y1)
+
+			mean := float64(sum) / float64(area)
+			variance := float64(sum2)/float64(area) - mean*mean
+			if variance < 0 {
+				variance = 0
+			}
+			stddev := math.Sqrt(variance)
+
+			threshold := mean * (1 + k*(stddev/128-1))
+
+			val := color.Gray{Y: 255}
+			if float64(gray.GrayAt(x, y).Y) <= threshold {
+				val = color.Gray{Y: 0}
+			}
+			out.SetGray(x, y, val)
+		}
+	}
+
+	return out
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// marginNoiseThreshold is the maximum fraction of dark pixels a border
+// row/column may contain before Wipe still considers it part of the margin.
+const marginNoiseThreshold = 0.005
+
+// Wipe clears whitespace-only margins from a binarized image: starting from
+// each edge, rows/columns whose dark-pixel ratio stays at or below
+// marginNoiseThreshold are treated as scan artifacts and forced to white.
+// The image dimensions are unchanged; only the detected margins are cleared.
+func Wipe(img *image.Gray) *image.Gray {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	out := image.NewGray(b)
+	copy(out.Pix, img.Pix)
+
+	top := marginExtent(img, h, func(i int) (int, int) { return 0, i }, w, true)
+	bottom := marginExtent(img, h, func(i int) (int, int) { return 0, h - 1 - i }, w, true)
+	left := marginExtent(img, w, func(i int) (int, int) { return i, 0 }, h, false)
+	right := marginExtent(img, w, func(i int) (int, int) { return w - 1 - i, 0 }, h, false)
+
+	for y := 0; y < top; y++ {
+		wipeRow(out, b, y)
+	}
+	for y := h - bottom; y < h; y++ {
+		wipeRow(out, b, y)
+	}
+	for x := 0; x < left; x++ {
+		wipeCol(out, b, x)
+	}
+	for x := w - right; x < w; x++ {
+		wipeCol(out, b, x)
+	}
+
+	return out
+}
+
+// marginExtent walks up to n rows/columns from an edge and returns how many
+// of them are whitespace-only margin, stopping at the first one that isn't.
+func marginExtent(img *image.Gray, n int, start func(i int) (int, int), length int, horizontal bool) int {
+	b := img.Bounds()
+	count := 0
+	for i := 0; i < n; i++ {
+		x0, y0 := start(i)
+		dark := 0
+		for j := 0; j < length; j++ {
+			x, y := x0, y0
+			if horizontal {
+				x = j
+			} else {
+				y = j
+			}
+			if img.GrayAt(b.Min.X+x, b.Min.Y+y).Y == 0 {
+				dark++
+			}
+		}
+		if float64(dark)/float64(length) > marginNoiseThreshold {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+func wipeRow(img *image.Gray, b image.Rectangle, y int) {
+	for x := b.Min.X; x < b.Max.X; x++ {
+		img.SetGray(x, b.Min.Y+y, color.Gray{Y: 255})
+	}
+}
+
+func wipeCol(img *image.Gray, b image.Rectangle, x int) {
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		img.SetGray(b.Min.X+x, y, color.Gray{Y: 255})
+	}
+}
@@ -0,0 +1,126 @@
+package preproc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// grayFromRows builds an image.Gray from literal pixel rows for compact
+// table-driven test cases.
+func grayFromRows(rows [][]uint8) *image.Gray {
+	h := len(rows)
+	w := 0
+	if h > 0 {
+		w = len(rows[0])
+	}
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y, row := range rows {
+		for x, v := range row {
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestBinarize(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   [][]uint8
+		window int
+		k      float64
+		want   [][]uint8
+	}{
+		{
+			name:   "uniform gray has no local variance so it binarizes to white",
+			window: 3,
+			k:      0.3,
+			rows: [][]uint8{
+				{128, 128, 128},
+				{128, 128, 128},
+				{128, 128, 128},
+			},
+			want: [][]uint8{
+				{255, 255, 255},
+				{255, 255, 255},
+				{255, 255, 255},
+			},
+		},
+		{
+			name:   "sharp half black half white edge binarizes cleanly",
+			window: 3,
+			k:      0.3,
+			rows: [][]uint8{
+				{0, 0, 255, 255},
+				{0, 0, 255, 255},
+				{0, 0, 255, 255},
+				{0, 0, 255, 255},
+			},
+			want: [][]uint8{
+				{0, 0, 255, 255},
+				{0, 0, 255, 255},
+				{0, 0, 255, 255},
+				{0, 0, 255, 255},
+			},
+		},
+		{
+			name:   "all white stays white",
+			window: 3,
+			k:      0.3,
+			rows: [][]uint8{
+				{255, 255},
+				{255, 255},
+			},
+			want: [][]uint8{
+				{255, 255},
+				{255, 255},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Binarize(grayFromRows(tt.rows), tt.window, tt.k)
+			want := grayFromRows(tt.want)
+
+			b := want.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if got.GrayAt(x, y) != want.GrayAt(x, y) {
+						t.Errorf("pixel (%d,%d) = %v, want %v", x, y, got.GrayAt(x, y), want.GrayAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWipe(t *testing.T) {
+	// A 6x6 binarized page: a two-pixel blank margin around a 2x2 ink block.
+	img := image.NewGray(image.Rect(0, 0, 6, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	for y := 2; y < 4; y++ {
+		for x := 2; x < 4; x++ {
+			img.SetGray(x, y, color.Gray{Y: 0})
+		}
+	}
+
+	out := Wipe(img)
+
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			inInk := x >= 2 && x < 4 && y >= 2 && y < 4
+			want := uint8(255)
+			if inInk {
+				want = 0
+			}
+			if got := out.GrayAt(x, y).Y; got != want {
+				t.Errorf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
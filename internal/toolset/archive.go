@@ -0,0 +1,156 @@
+package imageHandling
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveFormats lists the --archive values NewArchiveWriter accepts besides
+// the empty string, which writes loose files instead of building a
+// container.
+var archiveFormats = []string{"zip", "tar", "tar.gz", "tar.zst"}
+
+// ArchiveWriter accumulates the named byte entries produced during
+// extraction. The default implementation writes each entry as a loose file
+// under a directory; the zip/tar implementations stream entries into a
+// single container file instead, so the same extraction code path can
+// target either one.
+type ArchiveWriter interface {
+	// WriteFile adds an entry named name with the given contents.
+	WriteFile(name string, data []byte) error
+	// Close finalizes the archive, flushing any compression layers.
+	Close() error
+}
+
+// NewArchiveWriter returns the ArchiveWriter for the given --archive format.
+// format == "" writes loose files into dir (created if missing); "zip",
+// "tar", "tar.gz", and "tar.zst" each build a single container file named
+// dir plus the matching extension.
+func NewArchiveWriter(format, dir string) (ArchiveWriter, error) {
+	switch format {
+	case "":
+		if err := os.MkdirAll(dir, 0755); err != nil && !os.IsExist(err) {
+			return nil, err
+		}
+		return &dirArchiveWriter{dir: dir}, nil
+	case "zip":
+		f, err := os.Create(dir + ".zip")
+		if err != nil {
+			return nil, fmt.Errorf("create archive: %w", err)
+		}
+		return &zipArchiveWriter{f: f, zw: zip.NewWriter(f)}, nil
+	case "tar":
+		f, err := os.Create(dir + ".tar")
+		if err != nil {
+			return nil, fmt.Errorf("create archive: %w", err)
+		}
+		return &tarArchiveWriter{f: f, tw: tar.NewWriter(f)}, nil
+	case "tar.gz":
+		f, err := os.Create(dir + ".tar.gz")
+		if err != nil {
+			return nil, fmt.Errorf("create archive: %w", err)
+		}
+		gw := gzip.NewWriter(f)
+		return &tarArchiveWriter{f: f, gw: gw, tw: tar.NewWriter(gw)}, nil
+	case "tar.zst":
+		f, err := os.Create(dir + ".tar.zst")
+		if err != nil {
+			return nil, fmt.Errorf("create archive: %w", err)
+		}
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return &tarArchiveWriter{f: f, zstw: zw, tw: tar.NewWriter(zw)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s (want one of %v)", format, archiveFormats)
+	}
+}
+
+// dirArchiveWriter writes each entry as a loose file under dir, the
+// pre-archive extraction layout.
+type dirArchiveWriter struct {
+	dir string
+}
+
+func (w *dirArchiveWriter) WriteFile(name string, data []byte) error {
+	path := filepath.Join(w.dir, name)
+	if dir := filepath.Dir(path); dir != w.dir {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (w *dirArchiveWriter) Close() error { return nil }
+
+// zipArchiveWriter streams entries into a zip file.
+type zipArchiveWriter struct {
+	f  *os.File
+	zw *zip.Writer
+}
+
+func (w *zipArchiveWriter) WriteFile(name string, data []byte) error {
+	entry, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	if err := w.zw.Close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// tarArchiveWriter streams entries into a tarball, optionally wrapped in a
+// gzip (gw) or zstd (zstw) compression layer. Exactly one or neither of gw
+// and zstw is set.
+type tarArchiveWriter struct {
+	f    *os.File
+	gw   *gzip.Writer
+	zstw *zstd.Encoder
+	tw   *tar.Writer
+}
+
+func (w *tarArchiveWriter) WriteFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.gw != nil {
+		if err := w.gw.Close(); err != nil {
+			return err
+		}
+	}
+	if w.zstw != nil {
+		if err := w.zstw.Close(); err != nil {
+			return err
+		}
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,196 @@
+package imageHandling
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+func writeEntries(t *testing.T, format, dir string, entries []archiveEntry) {
+	t.Helper()
+
+	w, err := NewArchiveWriter(format, dir)
+	if err != nil {
+		t.Fatalf("NewArchiveWriter(%q): %v", format, err)
+	}
+	for _, e := range entries {
+		if err := w.WriteFile(e.name, e.data); err != nil {
+			t.Fatalf("WriteFile(%q): %v", e.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func assertEntries(t *testing.T, got map[string][]byte, want []archiveEntry) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d (%v)", len(got), len(want), got)
+	}
+	for _, e := range want {
+		data, ok := got[e.name]
+		if !ok {
+			t.Fatalf("missing entry %q", e.name)
+		}
+		if !bytes.Equal(data, e.data) {
+			t.Errorf("entry %q = %q, want %q", e.name, data, e.data)
+		}
+	}
+}
+
+func TestDirArchiveWriterRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	entries := []archiveEntry{
+		{"image_0000.png", []byte("flat entry")},
+		{"page_0001/image_01.png", []byte("nested entry")},
+	}
+	writeEntries(t, "", dir, entries)
+
+	got := make(map[string][]byte)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.name))
+		if err != nil {
+			t.Fatalf("ReadFile(%q): %v", e.name, err)
+		}
+		got[e.name] = data
+	}
+
+	assertEntries(t, got, entries)
+}
+
+func TestZipArchiveWriterRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	entries := []archiveEntry{
+		{"image_0000.png", []byte("first entry")},
+		{"page_0001/image_01.png", []byte("second entry")},
+		{"manifest.json", []byte("[]")},
+	}
+	writeEntries(t, "zip", dir, entries)
+
+	zr, err := zip.OpenReader(dir + ".zip")
+	if err != nil {
+		t.Fatalf("zip.OpenReader: %v", err)
+	}
+	defer zr.Close()
+
+	got := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open zip entry %q: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read zip entry %q: %v", f.Name, err)
+		}
+		got[f.Name] = data
+	}
+
+	assertEntries(t, got, entries)
+}
+
+func readTarEntries(t *testing.T, r io.Reader) map[string][]byte {
+	t.Helper()
+
+	tr := tar.NewReader(r)
+	got := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar.Next: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read tar entry %q: %v", hdr.Name, err)
+		}
+		got[hdr.Name] = data
+	}
+	return got
+}
+
+func TestTarArchiveWriterRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	entries := []archiveEntry{
+		{"image_0000.png", []byte("first entry")},
+		{"page_0001/image_01.png", []byte("second entry")},
+	}
+	writeEntries(t, "tar", dir, entries)
+
+	f, err := os.Open(dir + ".tar")
+	if err != nil {
+		t.Fatalf("open tar: %v", err)
+	}
+	defer f.Close()
+
+	assertEntries(t, readTarEntries(t, f), entries)
+}
+
+func TestTarGzArchiveWriterRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	entries := []archiveEntry{
+		{"image_0000.png", []byte("first entry")},
+		{"page_0001/image_01.png", []byte("second entry")},
+	}
+	writeEntries(t, "tar.gz", dir, entries)
+
+	f, err := os.Open(dir + ".tar.gz")
+	if err != nil {
+		t.Fatalf("open tar.gz: %v", err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	defer gr.Close()
+
+	assertEntries(t, readTarEntries(t, gr), entries)
+}
+
+func TestTarZstArchiveWriterRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	entries := []archiveEntry{
+		{"image_0000.png", []byte("first entry")},
+		{"page_0001/image_01.png", []byte("second entry")},
+	}
+	writeEntries(t, "tar.zst", dir, entries)
+
+	f, err := os.Open(dir + ".tar.zst")
+	if err != nil {
+		t.Fatalf("open tar.zst: %v", err)
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatalf("zstd.NewReader: %v", err)
+	}
+	defer zr.Close()
+
+	assertEntries(t, readTarEntries(t, zr), entries)
+}
+
+func TestNewArchiveWriterUnsupportedFormat(t *testing.T) {
+	if _, err := NewArchiveWriter("rar", filepath.Join(t.TempDir(), "out")); err == nil {
+		t.Fatal("expected an error for an unsupported archive format")
+	}
+}
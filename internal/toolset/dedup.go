@@ -0,0 +1,244 @@
+package imageHandling
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Deduplicator decides whether a newly extracted image is a duplicate of one
+// already seen. Implementations are not safe for concurrent use; extraction
+// hashes images sequentially even when encoding happens concurrently.
+//
+// decode is called only by strategies that need pixel data (e.g. phash), so
+// byte-identical strategies like sha256 never pay to decode the image.
+type Deduplicator interface {
+	// Check reports whether the image named name is a duplicate of an
+	// already-recorded image, returning that original's name. If it isn't
+	// a duplicate, it is recorded under name for future comparisons.
+	Check(name string, data []byte, decode func() (image.Image, error)) (dup bool, original string, err error)
+}
+
+// defaultPHashThreshold is the maximum Hamming distance between two
+// perceptual hashes for them to be considered duplicates.
+const defaultPHashThreshold = 5
+
+// NewDeduplicator builds the Deduplicator for the given --dedup mode:
+// "sha256" (default) collapses byte-identical files, "phash" collapses
+// near-duplicate images within threshold Hamming-distance bits, and "off"
+// disables deduplication entirely. threshold < 0 means "not set" and falls
+// back to defaultPHashThreshold; threshold == 0 is honored as-is (only
+// bit-identical pHashes count as duplicates).
+func NewDeduplicator(mode string, threshold int) (Deduplicator, error) {
+	switch mode {
+	case "", "sha256":
+		return &sha256Dedup{seen: make(map[string]string)}, nil
+	case "phash":
+		if threshold < 0 {
+			threshold = defaultPHashThreshold
+		}
+		return &phashDedup{threshold: threshold}, nil
+	case "off":
+		return offDedup{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dedup mode: %s", mode)
+	}
+}
+
+// sha256Dedup collapses images whose raw file bytes are identical.
+type sha256Dedup struct {
+	seen map[string]string // sha256 hex -> name of the first image with that hash
+}
+
+func (d *sha256Dedup) Check(name string, data []byte, _ func() (image.Image, error)) (bool, string, error) {
+	h := hashBytes(data)
+	if original, ok := d.seen[h]; ok {
+		return true, original, nil
+	}
+	d.seen[h] = name
+	return false, "", nil
+}
+
+// offDedup never reports a duplicate.
+type offDedup struct{}
+
+func (offDedup) Check(string, []byte, func() (image.Image, error)) (bool, string, error) {
+	return false, "", nil
+}
+
+// phashEntry is one recorded perceptual hash in the linear scan list.
+type phashEntry struct {
+	name string
+	hash uint64
+}
+
+// phashDedup collapses images whose perceptual hash lies within threshold
+// Hamming-distance bits of one already seen. Entries are kept in a simple
+// linear list and scanned in full for each new image; a BK-tree would cut
+// lookup cost for very large books but isn't needed at pixf's scale.
+type phashDedup struct {
+	threshold int
+	entries   []phashEntry
+}
+
+func (d *phashDedup) Check(name string, _ []byte, decode func() (image.Image, error)) (bool, string, error) {
+	img, err := decode()
+	if err != nil {
+		return false, "", fmt.Errorf("decode for phash: %w", err)
+	}
+
+	h := perceptualHash(img)
+
+	for _, e := range d.entries {
+		if bits.OnesCount64(h^e.hash) <= d.threshold {
+			return true, e.name, nil
+		}
+	}
+
+	d.entries = append(d.entries, phashEntry{name: name, hash: h})
+	return false, "", nil
+}
+
+// phashSize is the side length of the grayscale thumbnail the DCT runs over.
+const phashSize = 32
+
+// phashBlock is the side length of the low-frequency DCT block kept to build
+// the 64-bit hash.
+const phashBlock = 8
+
+// perceptualHash computes a 64-bit DCT-based perceptual hash: downscale to a
+// phashSize x phashSize grayscale thumbnail, run a 2D DCT, keep the
+// top-left phashBlock x phashBlock low-frequency coefficients, and set each
+// output bit to 1 iff that coefficient is above the median of the block's
+// AC (non-DC) coefficients.
+func perceptualHash(img image.Image) uint64 {
+	thumb := downscaleGray(img, phashSize, phashSize)
+
+	mat := make([][]float64, phashSize)
+	for y := 0; y < phashSize; y++ {
+		mat[y] = make([]float64, phashSize)
+		for x := 0; x < phashSize; x++ {
+			mat[y][x] = float64(thumb.GrayAt(x, y).Y)
+		}
+	}
+
+	freq := dct2D(mat)
+
+	coeffs := make([]float64, 0, phashBlock*phashBlock)
+	for y := 0; y < phashBlock; y++ {
+		for x := 0; x < phashBlock; x++ {
+			coeffs = append(coeffs, freq[y][x])
+		}
+	}
+
+	median := medianOf(coeffs[1:]) // exclude the DC term at index 0
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(len(coeffs)-1-i)
+		}
+	}
+
+	return hash
+}
+
+// downscaleGray box-averages img down to a w x h grayscale thumbnail.
+func downscaleGray(img image.Image, w, h int) *image.Gray {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0, sy1 := y*sh/h, (y+1)*sh/h
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < w; x++ {
+			sx0, sx1 := x*sw/w, (x+1)*sw/w
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var sum, count int
+			for sy := sy0; sy < sy1 && sy < sh; sy++ {
+				for sx := sx0; sx < sx1 && sx < sw; sx++ {
+					r, g, bl, _ := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					sum += int((299*r + 587*g + 114*bl) / 1000 >> 8)
+					count++
+				}
+			}
+			if count == 0 {
+				count = 1
+			}
+			out.SetGray(x, y, color.Gray{Y: uint8(sum / count)})
+		}
+	}
+	return out
+}
+
+// dct1D computes the 1D type-II DCT of in, orthonormalized so dct2D can be
+// applied independently to rows then columns.
+func dct1D(in []float64) []float64 {
+	n := len(in)
+	out := make([]float64, n)
+
+	for u := 0; u < n; u++ {
+		var sum float64
+		for x := 0; x < n; x++ {
+			sum += in[x] * math.Cos(math.Pi/float64(n)*(float64(x)+0.5)*float64(u))
+		}
+		cu := 1.0
+		if u == 0 {
+			cu = 1 / math.Sqrt2
+		}
+		out[u] = sum * cu * math.Sqrt(2.0/float64(n))
+	}
+
+	return out
+}
+
+// dct2D applies dct1D across rows and then columns of a square matrix.
+func dct2D(mat [][]float64) [][]float64 {
+	n := len(mat)
+
+	rowPass := make([][]float64, n)
+	for y := range mat {
+		rowPass[y] = dct1D(mat[y])
+	}
+
+	out := make([][]float64, n)
+	for y := range out {
+		out[y] = make([]float64, n)
+	}
+	col := make([]float64, n)
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			col[y] = rowPass[y][x]
+		}
+		col = dct1D(col)
+		for y := 0; y < n; y++ {
+			out[y][x] = col[y]
+		}
+	}
+
+	return out
+}
+
+// medianOf returns the median of vals without mutating the caller's slice.
+func medianOf(vals []float64) float64 {
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
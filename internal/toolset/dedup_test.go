@@ -0,0 +1,138 @@
+package imageHandling
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+	"testing"
+)
+
+func solidImage(w, h int, y uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for yy := 0; yy < h; yy++ {
+		for xx := 0; xx < w; xx++ {
+			img.SetGray(xx, yy, color.Gray{Y: y})
+		}
+	}
+	return img
+}
+
+func gradientImage(w, h int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for yy := 0; yy < h; yy++ {
+		for xx := 0; xx < w; xx++ {
+			img.SetGray(xx, yy, color.Gray{Y: uint8(((xx*255)/w + (yy*255)/h) / 2)})
+		}
+	}
+	return img
+}
+
+func checkerImage(w, h, cell int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for yy := 0; yy < h; yy++ {
+		for xx := 0; xx < w; xx++ {
+			v := uint8(0)
+			if (xx/cell+yy/cell)%2 == 0 {
+				v = 255
+			}
+			img.SetGray(xx, yy, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHashIdenticalImagesMatch(t *testing.T) {
+	a := perceptualHash(solidImage(64, 64, 200))
+	b := perceptualHash(solidImage(64, 64, 200))
+	if dist := bits.OnesCount64(a ^ b); dist != 0 {
+		t.Errorf("identical images hashed %d bits apart, want 0", dist)
+	}
+}
+
+func perceptualHashWrap(img image.Image) uint64 { return perceptualHash(img) }
+
+func TestPerceptualHashDissimilarImagesDiffer(t *testing.T) {
+	a := perceptualHashWrap(solidImage(64, 64, 10))
+	b := perceptualHashWrap(checkerImage(64, 64, 8))
+	if dist := bits.OnesCount64(a ^ b); dist < defaultPHashThreshold {
+		t.Errorf("a solid image and a checkerboard hashed %d bits apart, want >= %d", dist, defaultPHashThreshold)
+	}
+}
+
+func TestSHA256DedupCollapsesIdenticalBytes(t *testing.T) {
+	d := &sha256Dedup{seen: make(map[string]string)}
+	decode := func() (image.Image, error) { return nil, nil }
+
+	data := []byte("same bytes")
+	dup, _, err := d.Check("first", data, decode)
+	if err != nil || dup {
+		t.Fatalf("first image reported as duplicate: dup=%v err=%v", dup, err)
+	}
+
+	dup, original, err := d.Check("second", data, decode)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dup || original != "first" {
+		t.Errorf("Check() = (%v, %q), want (true, \"first\")", dup, original)
+	}
+}
+
+func TestNewDeduplicatorPHashThreshold(t *testing.T) {
+	d, err := NewDeduplicator("phash", -1)
+	if err != nil {
+		t.Fatalf("NewDeduplicator: %v", err)
+	}
+	if got := d.(*phashDedup).threshold; got != defaultPHashThreshold {
+		t.Errorf("unset threshold (-1) = %d, want default %d", got, defaultPHashThreshold)
+	}
+
+	d, err = NewDeduplicator("phash", 0)
+	if err != nil {
+		t.Fatalf("NewDeduplicator: %v", err)
+	}
+	if got := d.(*phashDedup).threshold; got != 0 {
+		t.Errorf("explicit threshold 0 was overridden to %d, want 0", got)
+	}
+}
+
+func TestOffDedupNeverReportsDuplicates(t *testing.T) {
+	d := offDedup{}
+	decode := func() (image.Image, error) { return nil, nil }
+
+	data := []byte("same bytes")
+	for i := 0; i < 3; i++ {
+		if dup, _, _ := d.Check("img", data, decode); dup {
+			t.Errorf("off dedup reported a duplicate on call %d", i)
+		}
+	}
+}
+
+func TestPHashDedupCollapsesNearDuplicates(t *testing.T) {
+	d := &phashDedup{threshold: defaultPHashThreshold}
+
+	decodeA := func() (image.Image, error) { return gradientImage(64, 64), nil }
+	dup, _, err := d.Check("a", nil, decodeA)
+	if err != nil || dup {
+		t.Fatalf("first image reported as duplicate: dup=%v err=%v", dup, err)
+	}
+
+	// A byte-for-byte re-encode of the same image should still match.
+	decodeB := func() (image.Image, error) { return gradientImage(64, 64), nil }
+	dup, original, err := d.Check("b", nil, decodeB)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dup || original != "a" {
+		t.Errorf("Check() = (%v, %q), want (true, \"a\")", dup, original)
+	}
+
+	decodeC := func() (image.Image, error) { return checkerImage(64, 64, 8), nil }
+	dup, _, err = d.Check("c", nil, decodeC)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dup {
+		t.Errorf("checkerboard image incorrectly reported as a duplicate of a gradient")
+	}
+}
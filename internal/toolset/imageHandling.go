@@ -5,16 +5,21 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/png"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/chai2010/webp"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+	"pixf/internal/preproc"
 )
 
 // ImageEncoder interface for encoding images
@@ -74,125 +79,337 @@ func toRGBA(img image.Image) *image.RGBA {
 	return rgba
 }
 
-// LoadedImage represents an image loaded from disk
+// LoadedImage is a decoded image pulled from a PDF, tagged with the pdfcpu
+// provenance (page/object number, original dimensions/colorspace) carried
+// through to the manifest and pages sidecar.
 type LoadedImage struct {
-	Img     image.Image
-	FileData []byte
+	Name       string
+	Img        image.Image
+	FileData   []byte
+	PageNr     int
+	ObjNr      int
+	Width      int
+	Height     int
+	ColorSpace string
+	Bpc        int
+}
+
+// BinarizeOptions configures the optional Sauvola binarization preprocessor.
+type BinarizeOptions struct {
+	Enabled bool
+	Window  int     // Sauvola local window size in pixels
+	K       float64 // Sauvola k parameter
+	Wipe    bool    // also clear whitespace-only margins after binarizing
+}
+
+// ExtractOptions configures the optional processing stages ExtractImagesFromFileWithOptions
+// applies in addition to format conversion.
+type ExtractOptions struct {
+	Binarize *BinarizeOptions
+	Dedup    Deduplicator // nil defaults to sha256 content-hash deduplication
+	Archive  string       // "" writes loose files; see archiveFormats for container formats
+	Pages    []string     // pdfcpu page selection (e.g. "1-10", "15", "20-"); nil/empty means all pages
+	Layout   string       // LayoutFlat (default) or LayoutPerPage
 }
 
 // ExtractImagesFromFile extracts images from a PDF file
 // For 'original' format, uses PDFCPU's ExtractImageFile for native format
 // For 'png' and 'webp', converts images with transparency support
 func ExtractImagesFromFile(filename string, imgDir string, format string) error {
-	if err := os.Mkdir(imgDir, 0755); err != nil && !os.IsExist(err) {
-		return err
+	return ExtractImagesFromFileWithOptions(filename, imgDir, format, ExtractOptions{})
+}
+
+// ExtractImagesFromFileWithOptions is ExtractImagesFromFile with optional
+// binarization, a choice of deduplication strategy, a choice of output
+// container, a page subset, and a choice of output layout. Binarizing
+// requires decoding every image, so it forces the concurrent encoder path
+// (defaulting format to "png") even when the caller asked for "original".
+// Every image written is recorded in manifest.json alongside the output,
+// noting its source page, PDF object number, format, and dedup hash; every
+// source image (including dropped duplicates) is also recorded in
+// pages.json, noting its page geometry and dedup group.
+func ExtractImagesFromFileWithOptions(filename string, imgDir string, format string, opts ExtractOptions) error {
+	dedup := opts.Dedup
+	if dedup == nil {
+		dedup, _ = NewDeduplicator("sha256", 0)
 	}
 
-	// For original format, use PDFCPU's native extraction with deduplication
-	if format == "original" || format == "" {
-		return extractImagesOriginal(filename, imgDir)
+	if opts.Layout == "" {
+		opts.Layout = LayoutFlat
+	} else if opts.Layout != LayoutFlat && opts.Layout != LayoutPerPage {
+		return fmt.Errorf("unsupported layout: %s (want %q or %q)", opts.Layout, LayoutFlat, LayoutPerPage)
+	}
+
+	if opts.Binarize != nil && opts.Binarize.Enabled && (format == "original" || format == "") {
+		format = "png"
 	}
 
-	// For other formats (png, webp), use concurrent processing
-	encoder, err := GetEncoder(format)
+	archive, err := NewArchiveWriter(opts.Archive, imgDir)
 	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+
+	var manifest []ManifestEntry
+	var pages []PageImageEntry
+	if format == "original" || format == "" {
+		manifest, pages, err = extractImagesOriginal(filename, archive, dedup, opts)
+	} else {
+		var encoder ImageEncoder
+		encoder, err = GetEncoder(format)
+		if err == nil {
+			manifest, pages, err = extractImagesConcurrent(filename, archive, encoder, opts.Binarize, dedup, opts)
+		}
+	}
+	if err != nil {
+		archive.Close()
 		return err
 	}
 
-	return extractImagesConcurrent(filename, imgDir, encoder)
+	if err := writeManifest(archive, manifest); err != nil {
+		archive.Close()
+		return err
+	}
+
+	if err := writePagesSidecar(archive, pages); err != nil {
+		archive.Close()
+		return err
+	}
+
+	return archive.Close()
+}
+
+// sourceImage is one embedded image resource read directly out of the PDF
+// via pdfcpu's digesting API, tagged with its page/object provenance.
+type sourceImage struct {
+	Name     string // synthetic name, e.g. "p0001_obj12.png"
+	PageNr   int
+	ObjNr    int
+	FileType string // original embedded format, lowercased (e.g. "png", "jpeg")
+	// Width, Height, ColorSpace and Bpc describe the rendered image data pdfcpu
+	// hands back, not the original PDF image XObject's declared dictionary
+	// entries (ExtractImagesRaw's non-stub path leaves those unset).
+	Width      int
+	Height     int
+	ColorSpace string
+	Bpc        int
+	Data       []byte
 }
 
-// extractImagesOriginal uses PDFCPU's ExtractImageFile for native format with deduplication
-func extractImagesOriginal(filename string, imgDir string) error {
-	// Extract images to temp directory
-	tempDir, err := os.MkdirTemp("", "pdfimg")
+// decodedImageMeta derives width, height, a PDF-style colorspace name and
+// bits-per-component from already-rendered image bytes, since pdfcpu's
+// ExtractImagesRaw doesn't surface the original XObject's dictionary entries
+// alongside the pixel data.
+func decodedImageMeta(data []byte) (width, height, bpc int, cs string, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("create temp dir: %w", err)
+		return 0, 0, 0, "", err
 	}
-	defer os.RemoveAll(tempDir)
 
-	if err := api.ExtractImagesFile(filename, tempDir, nil, nil); err != nil {
-		return fmt.Errorf("api.ExtractImagesFile: %w", err)
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		cs, bpc = model.DeviceGrayCS, 8
+	case color.Gray16Model:
+		cs, bpc = model.DeviceGrayCS, 16
+	case color.CMYKModel:
+		cs, bpc = model.DeviceCMYKCS, 8
+	case color.RGBA64Model, color.NRGBA64Model:
+		cs, bpc = model.DeviceRGBCS, 16
+	default:
+		cs, bpc = model.DeviceRGBCS, 8
 	}
 
-	// Read and process extracted images
-	files, err := os.ReadDir(tempDir)
+	return cfg.Width, cfg.Height, bpc, cs, nil
+}
+
+// loadSourceImages extracts every embedded image resource from filename
+// in-memory via pdfcpu's ExtractImagesRaw, so no temp directory is needed
+// before dedup/encoding/archiving take over. pageSelection is pdfcpu's page
+// selection syntax (e.g. []string{"1-10", "15", "20-"}); nil/empty means
+// every page.
+func loadSourceImages(filename string, pageSelection []string) ([]sourceImage, error) {
+	f, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("read temp dir: %w", err)
+		return nil, fmt.Errorf("open pdf: %w", err)
 	}
+	defer f.Close()
 
-	return processExtractedFilesSequential(files, tempDir, imgDir)
-}
-
-// extractImagesConcurrent extracts images using concurrent goroutines
-func extractImagesConcurrent(filename string, imgDir string, encoder ImageEncoder) error {
-	// Extract images to temp directory
-	tempDir, err := os.MkdirTemp("", "pdfimg")
+	pages, err := api.ExtractImagesRaw(f, pageSelection, nil)
 	if err != nil {
-		return fmt.Errorf("create temp dir: %w", err)
+		return nil, fmt.Errorf("api.ExtractImagesRaw: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
 
-	if err := api.ExtractImagesFile(filename, tempDir, nil, nil); err != nil {
-		return fmt.Errorf("api.ExtractImagesFile: %w", err)
+	var images []sourceImage
+	for _, pageImages := range pages {
+		for objNr, img := range pageImages {
+			data, err := io.ReadAll(img)
+			if err != nil {
+				return nil, fmt.Errorf("read embedded image: %w", err)
+			}
+
+			ext := strings.ToLower(img.FileType)
+			width, height, bpc, cs, err := decodedImageMeta(data)
+			if err != nil {
+				return nil, fmt.Errorf("decode embedded image metadata: %w", err)
+			}
+
+			images = append(images, sourceImage{
+				Name:       fmt.Sprintf("p%04d_obj%d.%s", img.PageNr, objNr, ext),
+				PageNr:     img.PageNr,
+				ObjNr:      objNr,
+				FileType:   ext,
+				Width:      width,
+				Height:     height,
+				ColorSpace: cs,
+				Bpc:        bpc,
+				Data:       data,
+			})
+		}
 	}
 
-	// Read all image files first
-	files, err := os.ReadDir(tempDir)
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].PageNr != images[j].PageNr {
+			return images[i].PageNr < images[j].PageNr
+		}
+		return images[i].ObjNr < images[j].ObjNr
+	})
+
+	return images, nil
+}
+
+// extractImagesOriginal writes out images in their native embedded format,
+// deduplicating as it goes.
+func extractImagesOriginal(filename string, archive ArchiveWriter, dedup Deduplicator, opts ExtractOptions) ([]ManifestEntry, []PageImageEntry, error) {
+	images, err := loadSourceImages(filename, opts.Pages)
 	if err != nil {
-		return fmt.Errorf("read temp dir: %w", err)
+		return nil, nil, err
 	}
 
-	// Collect image data with file content for deduplication
-	loadedImages := make([]LoadedImage, 0, len(files))
+	namer := newOutputNamer(opts.Layout, 0)
 
-	for _, f := range files {
-		if !isImageFile(f.Name()) {
-			continue
+	var manifest []ManifestEntry
+	var pages []PageImageEntry
+	dupCount := 0
+
+	for _, si := range images {
+		si := si
+		decode := func() (image.Image, error) {
+			img, _, err := image.Decode(bytes.NewReader(si.Data))
+			return img, err
 		}
 
-		imgPath := filepath.Join(tempDir, f.Name())
-		imgFile, err := os.Open(imgPath)
+		dup, original, err := dedup.Check(si.Name, si.Data, decode)
 		if err != nil {
-			return fmt.Errorf("open image: %w", err)
+			return nil, nil, fmt.Errorf("dedup %s: %w", si.Name, err)
 		}
 
-		rawImg, _, err := image.Decode(imgFile)
-		imgFile.Close()
-		if err != nil {
-			return fmt.Errorf("decode image: %w", err)
+		entry := PageImageEntry{
+			PageNr:     si.PageNr,
+			ObjNr:      si.ObjNr,
+			Width:      si.Width,
+			Height:     si.Height,
+			ColorSpace: si.ColorSpace,
+			Bpc:        si.Bpc,
+			DedupGroup: si.Name,
+			Duplicate:  dup,
+		}
+		if dup {
+			entry.DedupGroup = original
+			dupCount++
+			fmt.Printf("skipping %s: duplicate of %s\n", si.Name, original)
+			pages = append(pages, entry)
+			continue
 		}
 
-		// Read file content for deduplication
-		fileData, err := os.ReadFile(imgPath)
-		if err != nil {
-			return fmt.Errorf("read file data: %w", err)
+		ext := si.FileType
+		if ext == "" {
+			ext = "png"
+		}
+		name := namer.Name(si.PageNr, ext)
+		if err := archive.WriteFile(name, si.Data); err != nil {
+			return nil, nil, fmt.Errorf("write image: %w", err)
 		}
 
+		entry.Name = name
+		pages = append(pages, entry)
+		manifest = append(manifest, ManifestEntry{
+			Name:      name,
+			PageNr:    si.PageNr,
+			ObjNr:     si.ObjNr,
+			Format:    ext,
+			DedupHash: hashBytes(si.Data),
+		})
+	}
+
+	if dupCount > 0 {
+		fmt.Printf("skipped %d duplicate image(s)\n", dupCount)
+	}
+
+	return manifest, pages, nil
+}
+
+// extractImagesConcurrent decodes every embedded image, deduplicates
+// sequentially, then binarizes/encodes the survivors using a worker pool.
+func extractImagesConcurrent(filename string, archive ArchiveWriter, encoder ImageEncoder, binarize *BinarizeOptions, dedup Deduplicator, opts ExtractOptions) ([]ManifestEntry, []PageImageEntry, error) {
+	images, err := loadSourceImages(filename, opts.Pages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loadedImages := make([]LoadedImage, 0, len(images))
+	for _, si := range images {
+		img, _, err := image.Decode(bytes.NewReader(si.Data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode image: %w", err)
+		}
 		loadedImages = append(loadedImages, LoadedImage{
-			Img:     rawImg,
-			FileData: fileData,
+			Name:       si.Name,
+			Img:        img,
+			FileData:   si.Data,
+			PageNr:     si.PageNr,
+			ObjNr:      si.ObjNr,
+			Width:      si.Width,
+			Height:     si.Height,
+			ColorSpace: si.ColorSpace,
+			Bpc:        si.Bpc,
 		})
 	}
 
 	if len(loadedImages) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
-	// Calculate hashes for deduplication using file content (sequential)
-	seen := make(map[string]bool)
+	// Deduplicate using the configured strategy (sequential: Deduplicator
+	// implementations aren't safe for concurrent use), recording every
+	// source image's page entry regardless of whether it survives.
 	dupCount := 0
 	uniqueImages := make([]LoadedImage, 0, len(loadedImages))
+	pages := make([]PageImageEntry, len(loadedImages))
 
-	for _, li := range loadedImages {
-		// Hash the raw file content for deduplication
-		hash := hashBytes(li.FileData)
+	for i, li := range loadedImages {
+		li := li
+		decode := func() (image.Image, error) { return li.Img, nil }
+		dup, original, err := dedup.Check(li.Name, li.FileData, decode)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dedup %s: %w", li.Name, err)
+		}
 
-		if seen[hash] {
+		pages[i] = PageImageEntry{
+			PageNr:     li.PageNr,
+			ObjNr:      li.ObjNr,
+			Width:      li.Width,
+			Height:     li.Height,
+			ColorSpace: li.ColorSpace,
+			Bpc:        li.Bpc,
+			DedupGroup: li.Name,
+			Duplicate:  dup,
+		}
+
+		if dup {
+			pages[i].DedupGroup = original
 			dupCount++
+			fmt.Printf("skipping %s: duplicate of %s\n", li.Name, original)
 			continue
 		}
-		seen[hash] = true
 		uniqueImages = append(uniqueImages, li)
 	}
 
@@ -200,112 +417,128 @@ func extractImagesConcurrent(filename string, imgDir string, encoder ImageEncode
 		fmt.Printf("skipped %d duplicate image(s)\n", dupCount)
 	}
 
-	// Process unique images concurrently
-	return processImagesConcurrently(uniqueImages, imgDir, encoder)
+	manifest, err := processImagesConcurrently(uniqueImages, archive, encoder, binarize, opts.Layout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Patch in the final output names processImagesConcurrently chose,
+	// matched back to their page entry by (PageNr, ObjNr) since each
+	// embedded image object is unique per page.
+	nameByPageObj := make(map[[2]int]string, len(manifest))
+	for _, m := range manifest {
+		nameByPageObj[[2]int{m.PageNr, m.ObjNr}] = m.Name
+	}
+	for i := range pages {
+		if !pages[i].Duplicate {
+			pages[i].Name = nameByPageObj[[2]int{pages[i].PageNr, pages[i].ObjNr}]
+		}
+	}
+
+	return manifest, pages, nil
 }
 
-// processImagesConcurrently processes images with concurrent encoding
-func processImagesConcurrently(loadedImages []LoadedImage, imgDir string, encoder ImageEncoder) error {
-	type WriteTask struct {
-		Index int
-		Img   image.Image
+// processImagesConcurrently binarizes (if requested) and encodes images
+// using a worker pool, then writes the results through archive in a single
+// goroutine since ArchiveWriter implementations stream sequentially and
+// output names depend on the shared per-page/flat counters in outputNamer.
+func processImagesConcurrently(loadedImages []LoadedImage, archive ArchiveWriter, encoder ImageEncoder, binarize *BinarizeOptions, layout string) ([]ManifestEntry, error) {
+	type writeTask struct {
+		index int
+		li    LoadedImage
+	}
+	type writeResult struct {
+		index  int
+		pageNr int
+		objNr  int
+		data   []byte
 	}
 
-	// Create tasks
-	tasks := make([]WriteTask, 0, len(loadedImages))
+	tasks := make([]writeTask, len(loadedImages))
 	for i, li := range loadedImages {
-		tasks = append(tasks, WriteTask{
-			Index: i,
-			Img:   li.Img,
-		})
+		tasks[i] = writeTask{index: i, li: li}
 	}
 
 	numWorkers := 4
-	taskChan := make(chan WriteTask, len(tasks))
-	resultChan := make(chan error, len(tasks))
+	taskChan := make(chan writeTask, len(tasks))
+	resultChan := make(chan writeResult, len(tasks))
+	errChan := make(chan error, len(tasks))
 	var wg sync.WaitGroup
 
-	// Start worker goroutines
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for task := range taskChan {
-				err := writeImageFile(task.Img, encoder, imgDir, task.Index)
-				if err != nil {
-					resultChan <- err
+				img := task.li.Img
+				if binarize != nil && binarize.Enabled {
+					gray := preproc.Binarize(img, binarize.Window, binarize.K)
+					if binarize.Wipe {
+						gray = preproc.Wipe(gray)
+					}
+					img = gray
+				}
+
+				var buf bytes.Buffer
+				if err := encoder.Encode(&buf, img); err != nil {
+					errChan <- fmt.Errorf("encode: %w", err)
+					continue
+				}
+
+				resultChan <- writeResult{
+					index:  task.index,
+					pageNr: task.li.PageNr,
+					objNr:  task.li.ObjNr,
+					data:   buf.Bytes(),
 				}
 			}
 		}()
 	}
 
-	// Send tasks to workers
 	for _, task := range tasks {
 		taskChan <- task
 	}
 	close(taskChan)
 
-	// Wait for all workers to complete
 	go func() {
 		wg.Wait()
 		close(resultChan)
+		close(errChan)
 	}()
 
-	// Collect errors
-	for err := range resultChan {
-		if err != nil {
-			return err
-		}
+	results := make([]writeResult, 0, len(tasks))
+	for r := range resultChan {
+		results = append(results, r)
 	}
-
-	return nil
-}
-
-// processExtractedFilesSequential processes all files sequentially for original format
-func processExtractedFilesSequential(files []os.DirEntry, tempDir string, imgDir string) error {
-	seen := make(map[string]bool)
-	var dupCount int
-	uniqueCount := 0
-
-	for _, f := range files {
-		if f.IsDir() || !isImageFile(f.Name()) {
-			continue
-		}
-
-		imgPath := filepath.Join(tempDir, f.Name())
-
-		// Read file content for deduplication
-		fileData, err := os.ReadFile(imgPath)
+	for err := range errChan {
 		if err != nil {
-			return fmt.Errorf("read image: %w", err)
-		}
-
-		// Hash the raw file content for deduplication
-		hash := hashBytes(fileData)
-
-		if seen[hash] {
-			dupCount++
-			continue
-		}
-		seen[hash] = true
-
-		// Copy the file directly preserving original extension
-		origExt := strings.ToLower(filepath.Ext(f.Name()))
-		if origExt == "" {
-			origExt = ".png"
-		}
-		dstPath := filepath.Join(imgDir, fmt.Sprintf("image_%04d%s", uniqueCount, origExt))
-		if err := os.WriteFile(dstPath, fileData, 0644); err != nil {
-			return fmt.Errorf("write image: %w", err)
+			return nil, err
 		}
-		uniqueCount++
 	}
 
-	if dupCount > 0 {
-		fmt.Printf("skipped %d duplicate image(s)\n", dupCount)
+	// Results arrive in completion order; sort back to input order so
+	// naming (and, for per-page layout, per-page numbering) is deterministic
+	// regardless of worker scheduling.
+	sort.Slice(results, func(i, j int) bool { return results[i].index < results[j].index })
+
+	ext := strings.TrimPrefix(encoder.Extension(), ".")
+	namer := newOutputNamer(layout, 1)
+	manifest := make([]ManifestEntry, 0, len(results))
+	for _, r := range results {
+		name := namer.Name(r.pageNr, ext)
+		if err := archive.WriteFile(name, r.data); err != nil {
+			return nil, fmt.Errorf("write image: %w", err)
+		}
+		manifest = append(manifest, ManifestEntry{
+			Name:      name,
+			PageNr:    r.pageNr,
+			ObjNr:     r.objNr,
+			Format:    ext,
+			DedupHash: hashBytes(r.data),
+		})
 	}
 
-	return nil
+	return manifest, nil
 }
 
 // isImageFile checks if a filename has an image extension
@@ -320,17 +553,3 @@ func hashBytes(data []byte) string {
 	h.Write(data)
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
-
-// Write encoded image to disk
-func writeImageFile(img image.Image, encoder ImageEncoder, imgDir string, index int) error {
-	var buf bytes.Buffer
-	if err := encoder.Encode(&buf, img); err != nil {
-		return fmt.Errorf("encode: %w", err)
-	}
-
-	ext := encoder.Extension()
-	outName := fmt.Sprintf("image_%04d%s", index+1, ext)
-	outPath := filepath.Join(imgDir, outName)
-
-	return os.WriteFile(outPath, buf.Bytes(), 0644)
-}
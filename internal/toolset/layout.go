@@ -0,0 +1,47 @@
+package imageHandling
+
+import "fmt"
+
+const (
+	// LayoutFlat writes every image into the output root as image_%04d.<ext>,
+	// the original, back-compatible layout.
+	LayoutFlat = "flat"
+	// LayoutPerPage writes each image under page_%04d/image_%02d.<ext>,
+	// grouping output by source page.
+	LayoutPerPage = "per-page"
+)
+
+// outputNamer assigns output filenames for one extraction run according to
+// the requested --layout, keeping a running counter per page (per-page
+// layout) or a single running counter (flat layout).
+type outputNamer struct {
+	layout       string
+	flatCounter  int
+	pageCounters map[int]int
+}
+
+// newOutputNamer returns an outputNamer for layout, with the flat counter
+// starting at flatStart. The two flat-layout call sites historically number
+// from different starting points (0 for the original-format path, 1 for the
+// re-encoded path), so the starting point is left to the caller rather than
+// hard-coded here.
+func newOutputNamer(layout string, flatStart int) *outputNamer {
+	return &outputNamer{
+		layout:       layout,
+		flatCounter:  flatStart,
+		pageCounters: make(map[int]int),
+	}
+}
+
+// Name returns the next output filename for an image on pageNr with the
+// given extension (no leading dot).
+func (n *outputNamer) Name(pageNr int, ext string) string {
+	if n.layout == LayoutPerPage {
+		n.pageCounters[pageNr]++
+		return fmt.Sprintf("page_%04d/image_%02d.%s", pageNr, n.pageCounters[pageNr], ext)
+	}
+
+	name := fmt.Sprintf("image_%04d.%s", n.flatCounter, ext)
+	n.flatCounter++
+	return name
+}
@@ -0,0 +1,37 @@
+package imageHandling
+
+import "testing"
+
+func TestOutputNamerFlat(t *testing.T) {
+	n := newOutputNamer(LayoutFlat, 0)
+
+	got := []string{n.Name(1, "png"), n.Name(1, "png"), n.Name(2, "jpg")}
+	want := []string{"image_0000.png", "image_0001.png", "image_0002.jpg"}
+
+	for i, g := range got {
+		if g != want[i] {
+			t.Errorf("Name() #%d = %q, want %q", i, g, want[i])
+		}
+	}
+}
+
+func TestOutputNamerFlatStartsAtGivenOffset(t *testing.T) {
+	n := newOutputNamer(LayoutFlat, 1)
+
+	if got, want := n.Name(1, "png"), "image_0001.png"; got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+}
+
+func TestOutputNamerPerPage(t *testing.T) {
+	n := newOutputNamer(LayoutPerPage, 0)
+
+	got := []string{n.Name(1, "png"), n.Name(1, "png"), n.Name(2, "jpg")}
+	want := []string{"page_0001/image_01.png", "page_0001/image_02.png", "page_0002/image_01.jpg"}
+
+	for i, g := range got {
+		if g != want[i] {
+			t.Errorf("Name() #%d = %q, want %q", i, g, want[i])
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package imageHandling
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ManifestEntry records provenance for one extracted image: the PDF page
+// and object it came from, the format it was written out in, and a
+// content hash so downstream consumers can detect duplicates across runs
+// without re-parsing filenames.
+type ManifestEntry struct {
+	Name      string `json:"name"`
+	PageNr    int    `json:"page_nr"`
+	ObjNr     int    `json:"obj_nr"`
+	Format    string `json:"format"`
+	DedupHash string `json:"dedup_hash"` // sha256 of the written bytes
+}
+
+// writeManifest serializes entries as manifest.json inside archive.
+func writeManifest(archive ArchiveWriter, entries []ManifestEntry) error {
+	if entries == nil {
+		entries = []ManifestEntry{}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	return archive.WriteFile("manifest.json", data)
+}
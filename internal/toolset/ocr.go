@@ -0,0 +1,347 @@
+package imageHandling
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// OCROptions configures the optional OCR stage run after image extraction.
+type OCROptions struct {
+	Enabled     bool   // run tesseract over every extracted image
+	Lang        string // tesseract -l language(s), e.g. "eng" or "eng+deu"
+	TessCmd     string // path to the tesseract binary, defaults to "tesseract" on PATH
+	TrainingDir string // optional --tessdata-dir override
+	// PageRender tells tesseract to expect a full page of text (psm 3) instead
+	// of sparse text in a cropped figure (psm 11). It does NOT rasterize PDF
+	// pages itself - pdfcpu has no page-rendering engine, so this only helps
+	// for scanned books where each page is already one big embedded image;
+	// pages built from vector content with no embedded raster still won't be
+	// OCR'd.
+	PageRender    bool
+	SearchablePDF bool // also build a searchable output.pdf overlaying OCR text
+}
+
+// defaultTessCmd is used when OCROptions.TessCmd is empty.
+const defaultTessCmd = "tesseract"
+
+// ExtractAndOCR extracts images the same way ExtractImagesFromFile does, then
+// runs each unique image through tesseract to produce .hocr and .txt
+// sidecars, a merged book.hocr, and (if requested) a searchable output.pdf.
+// It degrades gracefully when tesseract is unavailable: extraction still
+// succeeds and a warning is printed instead of failing the whole run.
+func ExtractAndOCR(filename, imgDir, format string, opts OCROptions, extractOpts ExtractOptions) error {
+	if err := ExtractImagesFromFileWithOptions(filename, imgDir, format, extractOpts); err != nil {
+		return err
+	}
+
+	if !opts.Enabled {
+		return nil
+	}
+
+	if extractOpts.Archive != "" {
+		fmt.Printf("warning: --ocr requires loose extracted files, skipping OCR for --archive=%s output\n", extractOpts.Archive)
+		return nil
+	}
+
+	tessCmd := opts.TessCmd
+	if tessCmd == "" {
+		tessCmd = defaultTessCmd
+	}
+
+	tessPath, err := exec.LookPath(tessCmd)
+	if err != nil {
+		fmt.Printf("warning: %s not found, skipping OCR\n", tessCmd)
+		return nil
+	}
+
+	// Walk rather than a flat ReadDir so --layout=per-page's page_%04d/
+	// subdirectories are picked up too.
+	var imgPaths []string
+	err = filepath.WalkDir(imgDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isImageFile(d.Name()) {
+			imgPaths = append(imgPaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read image dir: %w", err)
+	}
+	sort.Strings(imgPaths)
+
+	if len(imgPaths) == 0 {
+		return nil
+	}
+
+	if err := ocrImagesConcurrently(imgPaths, tessPath, opts); err != nil {
+		return err
+	}
+
+	if err := mergeHOCR(imgPaths, filepath.Join(imgDir, "book.hocr")); err != nil {
+		return fmt.Errorf("merge hocr: %w", err)
+	}
+
+	if opts.SearchablePDF {
+		if err := buildSearchablePDF(imgPaths, filepath.Join(imgDir, "output.pdf")); err != nil {
+			return fmt.Errorf("build searchable pdf: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ocrImagesConcurrently runs tesseract over imgPaths using the same
+// fixed-size worker pool shape as processImagesConcurrently.
+func ocrImagesConcurrently(imgPaths []string, tessPath string, opts OCROptions) error {
+	numWorkers := 4
+	taskChan := make(chan string, len(imgPaths))
+	resultChan := make(chan error, len(imgPaths))
+	var wg sync.WaitGroup
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for imgPath := range taskChan {
+				if err := runTesseract(tessPath, imgPath, opts); err != nil {
+					resultChan <- err
+				}
+			}
+		}()
+	}
+
+	for _, p := range imgPaths {
+		taskChan <- p
+	}
+	close(taskChan)
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	for err := range resultChan {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runTesseract OCRs a single image, writing "<image>.hocr" and "<image>.txt"
+// sidecars next to it.
+func runTesseract(tessPath, imgPath string, opts OCROptions) error {
+	outBase := strings.TrimSuffix(imgPath, filepath.Ext(imgPath))
+
+	args := []string{imgPath, outBase}
+	if opts.Lang != "" {
+		args = append(args, "-l", opts.Lang)
+	}
+	if opts.TrainingDir != "" {
+		args = append(args, "--tessdata-dir", opts.TrainingDir)
+	}
+	if !opts.PageRender {
+		// Extracted figures/photos rarely fill the frame with text the way a
+		// scanned page does, so ask tesseract for sparse-text segmentation
+		// instead of its full-page default (psm 3).
+		args = append(args, "--psm", "11")
+	}
+	args = append(args, "hocr", "txt")
+
+	cmd := exec.Command(tessPath, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tesseract %s: %w: %s", filepath.Base(imgPath), err, out)
+	}
+
+	return nil
+}
+
+// hocrLineRe matches a single ocr_line span, capturing its bbox and inner
+// markup (which still contains nested ocrx_word spans). The line ends at the
+// first closing tag directly followed by another one: the last word's
+// </span> and then the line's own.
+var hocrLineRe = regexp.MustCompile(`(?s)<span class='ocr_line'[^>]*title="bbox (\d+) (\d+) (\d+) (\d+)[^"]*"[^>]*>(.*?</span>)\s*</span>`)
+
+// hocrTagRe strips any tag, leaving plain text behind.
+var hocrTagRe = regexp.MustCompile(`<[^>]+>`)
+
+// hocrLine is one recognized line of text with its pixel bounding box.
+type hocrLine struct {
+	x0, y0, x1, y1 int
+	text           string
+}
+
+// parseHOCRLines extracts ocr_line bounding boxes and text from a hOCR file.
+func parseHOCRLines(hocrPath string) ([]hocrLine, error) {
+	data, err := os.ReadFile(hocrPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []hocrLine
+	for _, m := range hocrLineRe.FindAllStringSubmatch(string(data), -1) {
+		x0, _ := strconv.Atoi(m[1])
+		y0, _ := strconv.Atoi(m[2])
+		x1, _ := strconv.Atoi(m[3])
+		y1, _ := strconv.Atoi(m[4])
+		text := strings.TrimSpace(hocrTagRe.ReplaceAllString(m[5], " "))
+		if text == "" {
+			continue
+		}
+		lines = append(lines, hocrLine{x0: x0, y0: y0, x1: x1, y1: y1, text: text})
+	}
+
+	return lines, nil
+}
+
+// mergeHOCR concatenates the per-image .hocr sidecars for imgPaths into a
+// single book.hocr with one ocr_page div per image, in extraction order.
+func mergeHOCR(imgPaths []string, outPath string) error {
+	var body strings.Builder
+	body.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	body.WriteString("<!DOCTYPE html>\n<html><head><title>book</title>\n")
+	body.WriteString("<meta http-equiv=\"Content-Type\" content=\"text/html;charset=utf-8\"/>\n")
+	body.WriteString("<meta name='ocr-system' content='tesseract'/>\n</head><body>\n")
+
+	found := false
+	for i, imgPath := range imgPaths {
+		hocrPath := strings.TrimSuffix(imgPath, filepath.Ext(imgPath)) + ".hocr"
+		data, err := os.ReadFile(hocrPath)
+		if err != nil {
+			continue
+		}
+		found = true
+
+		page := extractHOCRBody(string(data))
+		fmt.Fprintf(&body, "<div class='ocr_page' id='page_%d' title='image %q'>\n%s\n</div>\n", i+1, filepath.Base(imgPath), page)
+	}
+	body.WriteString("</body></html>\n")
+
+	if !found {
+		return nil
+	}
+
+	return os.WriteFile(outPath, []byte(body.String()), 0644)
+}
+
+// hocrBodyRe pulls out the contents of <body>...</body> from a per-image
+// hOCR file so it can be re-wrapped as a page div in the merged book.hocr.
+var hocrBodyRe = regexp.MustCompile(`(?s)<body>(.*)</body>`)
+
+func extractHOCRBody(hocr string) string {
+	m := hocrBodyRe.FindStringSubmatch(hocr)
+	if m == nil {
+		return hocr
+	}
+	return m[1]
+}
+
+// buildSearchablePDF lays each image down as a full-bleed page, overlays its
+// recognized text as a near-invisible watermark per line (pdfcpu's watermark
+// API has no true Tr-3 invisible render mode, so Opacity 0 stands in for
+// it), and merges the resulting single-page PDFs into outPath.
+func buildSearchablePDF(imgPaths []string, outPath string) error {
+	tmpDir, err := os.MkdirTemp("", "pixf-ocr-pdf")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	conf := model.NewDefaultConfiguration()
+	var pagePDFs []string
+
+	for i, imgPath := range imgPaths {
+		w, h, err := imageDimensions(imgPath)
+		if err != nil {
+			continue
+		}
+
+		pagePDF := filepath.Join(tmpDir, fmt.Sprintf("page_%04d.pdf", i))
+		imp := &pdfcpu.Import{
+			PageDim:  &types.Dim{Width: float64(w), Height: float64(h)},
+			UserDim:  true,
+			Pos:      types.Full,
+			Scale:    1,
+			ScaleAbs: true,
+			InpUnit:  types.POINTS,
+		}
+		if err := api.ImportImagesFile([]string{imgPath}, pagePDF, imp, conf); err != nil {
+			return fmt.Errorf("import page image %s: %w", imgPath, err)
+		}
+
+		hocrPath := strings.TrimSuffix(imgPath, filepath.Ext(imgPath)) + ".hocr"
+		lines, err := parseHOCRLines(hocrPath)
+		if err == nil && len(lines) > 0 {
+			wms := make([]*model.Watermark, 0, len(lines))
+			for _, l := range lines {
+				wm, err := textWatermarkForLine(l, h)
+				if err != nil {
+					continue
+				}
+				wms = append(wms, wm)
+			}
+			if len(wms) > 0 {
+				m := map[int][]*model.Watermark{1: wms}
+				if err := api.AddWatermarksSliceMapFile(pagePDF, pagePDF, m, conf); err != nil {
+					return fmt.Errorf("overlay ocr text on %s: %w", imgPath, err)
+				}
+			}
+		}
+
+		pagePDFs = append(pagePDFs, pagePDF)
+	}
+
+	if len(pagePDFs) == 0 {
+		return nil
+	}
+
+	return api.MergeCreateFile(pagePDFs, outPath, false, conf)
+}
+
+// textWatermarkForLine builds a text watermark positioned at a hOCR line's
+// bounding box, flipping the Y axis from hOCR's top-left origin to PDF's
+// bottom-left origin.
+func textWatermarkForLine(l hocrLine, pageHeight int) (*model.Watermark, error) {
+	fontSize := l.y1 - l.y0
+	if fontSize < 4 {
+		fontSize = 4
+	}
+
+	dy := float64(pageHeight - l.y1)
+	desc := fmt.Sprintf("font:Helvetica, points:%d, pos:bl, offset:%d %d, scale:1 abs, opacity:0", fontSize, l.x0, int(dy))
+
+	return api.TextWatermark(l.text, desc, true, false, types.POINTS)
+}
+
+// imageDimensions decodes just enough of an image file to get its pixel size.
+func imageDimensions(imgPath string) (int, int, error) {
+	f, err := os.Open(imgPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
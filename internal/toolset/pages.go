@@ -0,0 +1,40 @@
+package imageHandling
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PageImageEntry records one source image's page-level provenance for
+// pages.json: its page and object number, the image's own pixel dimensions
+// and colorspace, and the dedup group it was folded into. pdfcpu's
+// extraction API hands back rendered image bytes rather than the original
+// XObject's placement matrix or dictionary entries, so Width/Height/Bpc/
+// ColorSpace describe the rendered image itself (decoded from the image
+// bytes pdfcpu extracts, before any re-encoding or binarization) rather than
+// a true on-page bounding box or the PDF stream's own declared values.
+type PageImageEntry struct {
+	Name       string `json:"name,omitempty"` // output filename; empty if this was a duplicate and wasn't written
+	PageNr     int    `json:"page_nr"`
+	ObjNr      int    `json:"obj_nr"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	ColorSpace string `json:"colorspace"`
+	Bpc        int    `json:"bpc"`
+	DedupGroup string `json:"dedup_group"` // synthetic name of the representative image this was folded into (itself if unique)
+	Duplicate  bool   `json:"duplicate"`
+}
+
+// writePagesSidecar serializes entries as pages.json inside archive.
+func writePagesSidecar(archive ArchiveWriter, entries []PageImageEntry) error {
+	if entries == nil {
+		entries = []PageImageEntry{}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal pages sidecar: %w", err)
+	}
+
+	return archive.WriteFile("pages.json", data)
+}
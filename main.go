@@ -25,6 +25,21 @@ Options:
   -h, --help           Show this help message
   --unlock-only        Only unlock the PDF, do not extract images
   --extract-only       Only extract images, do not unlock the PDF first
+  --ocr                Run OCR over extracted images, writing .hocr/.txt sidecars
+  --lang string        Tesseract language(s) to use, e.g. "eng" or "eng+deu" (default "eng")
+  --tesscmd string     Path to the tesseract binary (default "tesseract" on PATH)
+  --training string    Optional --tessdata-dir override passed through to tesseract
+  --ocr-page-render    Expect a full page of text, not a cropped figure (scanned books); does not rasterize pages itself
+  --searchable-pdf     Also build output.pdf overlaying OCR text on the page images
+  --binarize           Binarize extracted images with Sauvola adaptive thresholding
+  --sauvola-window int Sauvola local window size in pixels (default 41)
+  --sauvola-k float    Sauvola k parameter (default 0.3)
+  --wipe               Clear whitespace-only margins after binarizing
+  --dedup string       Deduplication strategy: sha256, phash, or off (default "sha256")
+  --phash-threshold int  Max Hamming distance for --dedup=phash duplicates (default 5; 0 means only bit-identical pHashes match)
+  --archive string     Bundle extracted output into one archive: zip, tar, tar.gz, or tar.zst
+  --pages string       Only extract from these pages, e.g. "1-10,15,20-" (default all pages)
+  --layout string      Output layout: flat or per-page (default "flat")
 
 Format Options:
   original    Extract images using PDF's native format (default)
@@ -36,6 +51,7 @@ Examples:
   pixf document.pdf png                # Unlock and extract as PNG
   pixf --unlock-only document.pdf      # Only unlock the PDF
   pixf --extract-only document.pdf     # Only extract images from PDF
+  pixf --ocr --lang eng document.pdf   # Extract images and OCR each one
   pixf -h                              # Show this help message`)
 }
 
@@ -45,6 +61,21 @@ func main() {
 	helpFlagLong := flag.Bool("help", false, "Show help")
 	unlockOnly := flag.Bool("unlock-only", false, "Only unlock the PDF")
 	extractOnly := flag.Bool("extract-only", false, "Only extract images")
+	ocr := flag.Bool("ocr", false, "Run OCR over extracted images")
+	lang := flag.String("lang", "eng", "Tesseract language(s), e.g. eng or eng+deu")
+	tessCmd := flag.String("tesscmd", "", "Path to the tesseract binary")
+	training := flag.String("training", "", "Optional --tessdata-dir override")
+	ocrPageRender := flag.Bool("ocr-page-render", false, "Expect a full page of text, not a cropped figure; does not rasterize pages itself")
+	searchablePDF := flag.Bool("searchable-pdf", false, "Also build output.pdf overlaying OCR text on the page images")
+	binarize := flag.Bool("binarize", false, "Binarize extracted images with Sauvola adaptive thresholding")
+	sauvolaWindow := flag.Int("sauvola-window", 41, "Sauvola local window size in pixels")
+	sauvolaK := flag.Float64("sauvola-k", 0.3, "Sauvola k parameter")
+	wipe := flag.Bool("wipe", false, "Clear whitespace-only margins after binarizing")
+	dedupMode := flag.String("dedup", "sha256", "Deduplication strategy: sha256, phash, or off")
+	phashThreshold := flag.Int("phash-threshold", -1, "Max Hamming distance for --dedup=phash duplicates (default 5; 0 means only bit-identical pHashes match)")
+	archiveFormat := flag.String("archive", "", "Bundle extracted output into one archive: zip, tar, tar.gz, or tar.zst")
+	pages := flag.String("pages", "", `Only extract from these pages, e.g. "1-10,15,20-" (default all pages)`)
+	layout := flag.String("layout", imageHandling.LayoutFlat, "Output layout: flat or per-page")
 
 	flag.Parse()
 
@@ -102,18 +133,53 @@ func main() {
 		return
 	}
 
+	ocrOpts := imageHandling.OCROptions{
+		Enabled:       *ocr,
+		Lang:          *lang,
+		TessCmd:       *tessCmd,
+		TrainingDir:   *training,
+		PageRender:    *ocrPageRender,
+		SearchablePDF: *searchablePDF,
+	}
+
+	binarizeOpts := &imageHandling.BinarizeOptions{
+		Enabled: *binarize,
+		Window:  *sauvolaWindow,
+		K:       *sauvolaK,
+		Wipe:    *wipe,
+	}
+
+	dedup, err := imageHandling.NewDeduplicator(*dedupMode, *phashThreshold)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	var pageSelection []string
+	if *pages != "" {
+		pageSelection = strings.Split(*pages, ",")
+	}
+
+	extractOpts := imageHandling.ExtractOptions{
+		Binarize: binarizeOpts,
+		Dedup:    dedup,
+		Archive:  *archiveFormat,
+		Pages:    pageSelection,
+		Layout:   *layout,
+	}
+
 	// Handle extract-only mode (use original PDF without unlocking)
 	if *extractOnly {
 		fmt.Println("Extracting images from:", filename)
 		nameOnly := strings.TrimSuffix(filename, ".pdf")
 		imgDir := "images_" + nameOnly
 
-		err := imageHandling.ExtractImagesFromFile(filename, imgDir, format)
+		err := imageHandling.ExtractAndOCR(filename, imgDir, format, ocrOpts, extractOpts)
 		if err != nil {
 			fmt.Println("Error extracting images:", err)
 			os.Exit(1)
 		}
-		fmt.Println("Images extracted to:", imgDir)
+		fmt.Println("Images extracted to:", extractionOutputPath(imgDir, *archiveFormat))
 		return
 	}
 
@@ -123,7 +189,7 @@ func main() {
 	// PDFCPU Unlocking
 	conf := model.NewDefaultConfiguration()
 	filenameUnlocked := "unlocked_" + filename
-	err := api.DecryptFile(filename, filenameUnlocked, conf)
+	err = api.DecryptFile(filename, filenameUnlocked, conf)
 	if err != nil {
 		fmt.Println("Error decrypting PDF:", err)
 		os.Exit(1)
@@ -135,11 +201,21 @@ func main() {
 	imgDir := "images_" + nameOnly
 
 	fmt.Println("Extracting images in", format, "format...")
-	err = imageHandling.ExtractImagesFromFile(filenameUnlocked, imgDir, format)
+	err = imageHandling.ExtractAndOCR(filenameUnlocked, imgDir, format, ocrOpts, extractOpts)
 	if err != nil {
 		fmt.Println("Error extracting images:", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Images extracted to:", imgDir)
+	fmt.Println("Images extracted to:", extractionOutputPath(imgDir, *archiveFormat))
+}
+
+// extractionOutputPath reports where extraction actually wrote its output:
+// imgDir for loose files, or imgDir plus the matching extension when
+// --archive bundled it into a single container file.
+func extractionOutputPath(imgDir, archiveFormat string) string {
+	if archiveFormat == "" {
+		return imgDir
+	}
+	return imgDir + "." + archiveFormat
 }